@@ -3,344 +3,453 @@ package main
 
 import (
   "runtime"
-  "net/http"
-  "net/url"
   "path"
   "path/filepath"
   "io"
   "io/ioutil"
-  "encoding/xml"
+  "encoding/json"
+  "hash/adler32"
+  "fmt"
   "os"
+  "os/signal"
   "flag"
   "log"
-)
+  "time"
+  "context"
+  "net/http"
+  "syscall"
 
-/* Solr XML Response header types */
-type ResponseHeader struct {
-  Metadata []HeaderData `xml:"int"`
-}
+  "github.com/cheggaaa/pb"
+  "golang.org/x/time/rate"
+)
 
-type HeaderData struct {
-  Name string `xml:"name,attr"`
-  Value string `xml:",innerxml"`
+/* Goroutine Channel types */
+type DownloadResult struct {
+  Name string
+  StatusCode int
+  Skipped bool
+  Bytes int64
+  Err error `json:"-"`
 }
 
-/* Solr XML Index Discovery types */
-type DiscoveryResult struct {
-  Header ResponseHeader `xml:"lst"`
-  VersionInfo []VersionInfo `xml:"long"`
+type Download struct {
+  Source Source
+  Version Version
+  File RemoteFile
 }
 
-type VersionInfo struct {
-  Name string `xml:"name,attr"`
-  Value string `xml:",innerxml"`
+// Stats is the structured summary emitted to stdout on completion so the
+// tool can be composed in scripts instead of scraped from log lines.
+type Stats struct {
+  Files int `json:"files"`
+  Bytes int64 `json:"bytes"`
+  ElapsedSeconds float64 `json:"elapsedSeconds"`
+  ThroughputBytesPerSec float64 `json:"throughputBytesPerSec"`
+  PerFile []FileStat `json:"perFile"`
 }
 
-/* Solr XML File Discovery types */
-type FileListResult struct {
-  Header ResponseHeader `xml:"lst"`
-  Filesets []FileList `xml:"arr"`
+type FileStat struct {
+  Name string `json:"name"`
+  StatusCode int `json:"statusCode"`
+  Skipped bool `json:"skipped"`
+  Bytes int64 `json:"bytes"`
 }
 
-type FileList struct {
-  Name  string      `xml:"name,attr"`
-  Files []IndexFile `xml:"lst"`
+// Per-file record persisted to SuccessFile so the next run can tell which
+// files are already present and valid, and resume like a true incremental
+// replica instead of re-downloading the whole index.
+type FileRecord struct {
+  Name string `json:"name"`
+  Version string `json:"version"`
+  Generation string `json:"generation"`
+  Size int64 `json:"size"`
+  Checksum uint32 `json:"checksum,omitempty"`
+  HasChecksum bool `json:"hasChecksum"`
 }
 
-type IndexFile struct {
-  Name string `xml:"str"`
-  Size string `xml:"long"`
-}
+const maxDownloadAttempts = 5
 
-/* Goroutine Channel types */
-type SolrIndex struct {
-  Url string
-  Version string
-  Generation string
-}
+var workers int
 
-type DownloadResult struct {
-  Url string
-  StatusCode int
+var SolrUrl,
+  OutputPath,
+  SuccessFile,
+  SourceName string
+
+var NoProgress, Silent bool
+var Timeout, FetchDelay time.Duration
+var Concurrency int
+var MaxBandwidthMBps float64
+
+// rateLimitedReader throttles reads against a token-bucket limiter so a
+// replica can cap how hard it hits the master, rather than saturating it.
+type rateLimitedReader struct {
+  ctx context.Context
+  r io.Reader
+  limiter *rate.Limiter
 }
 
-type Download struct {
-  Name string
-  Url string
-  Results chan<- DownloadResult
+func (rl *rateLimitedReader) Read(p []byte) (int, error) {
+  n, err := rl.r.Read(p)
+  if n > 0 {
+    if waitErr := rl.limiter.WaitN(rl.ctx, n); waitErr != nil {
+      return n, waitErr
+    }
+  }
+  return n, err
 }
 
-var workers = runtime.NumCPU()/2
-
-var SolrUrl,
-  OutputPath,
-  SuccessFile string
+func (download Download) Do(ctx context.Context, outputPath string, bar *pb.ProgressBar, limiter *rate.Limiter) DownloadResult {
+  destination := path.Join(outputPath, download.File.Name)
 
-func (download Download) Do(outputPath string) {
-  out, err := os.Create(path.Join(outputPath, download.Name))
-  defer out.Close()
-  if err != nil {
-    log.Fatal(err)
+  if existing, err := os.Stat(destination); err == nil && download.alreadySatisfiedBy(existing.Size(), destination) {
+    if bar != nil {
+      bar.Add64(download.File.Size)
+    }
+    return DownloadResult{Name: download.File.Name, StatusCode: http.StatusOK, Skipped: true}
   }
 
-  response, err := http.Get(download.Url)
-  defer response.Body.Close()
-  if err != nil {
-    log.Fatal(err)
-  }
+  var err error
+  var bytesCopied int64
+  var statusCode int
+  for attempt := 0; attempt < maxDownloadAttempts; attempt++ {
+    if ctx.Err() != nil {
+      err = ctx.Err()
+      break
+    }
+    if attempt > 0 {
+      backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+      log.Printf("retrying %s in %s (attempt %d/%d): %v", download.File.Name, backoff, attempt+1, maxDownloadAttempts, err)
+      select {
+      case <-time.After(backoff):
+      case <-ctx.Done():
+        err = ctx.Err()
+        continue
+      }
+    }
 
-  _, err = io.Copy(out, response.Body)
-  if err != nil {
-    log.Fatal(err)
+    bytesCopied, statusCode, err = download.fetchAndVerify(ctx, destination, bar, limiter)
+    if err == nil {
+      break
+    }
   }
-  download.Results <- DownloadResult{download.Url, response.StatusCode}
-}
-
-func init() {
-  defaultSuccessFile, err := filepath.Abs(filepath.Dir(os.Args[0]))
   if err != nil {
-    log.Fatal(err)
+    return DownloadResult{Name: download.File.Name, Err: err}
   }
 
-  const (
-    defaultSolrUrl = "http://172.20.20.20:8983/solr"
-    defaultOutputPath = "/var/lib/solr/data"
-  )
-
-  flag.StringVar(&SolrUrl, "l", defaultSolrUrl, "Location of the Solr server (ie: http://localhost:8983/solr)")
-  flag.StringVar(&OutputPath, "o", defaultOutputPath, "Output location of the downloaded solr index")
-  flag.StringVar(&SuccessFile, "s", defaultSuccessFile, "Path to the file which indicates that all the files downloaded successfully")
+  return DownloadResult{Name: download.File.Name, StatusCode: statusCode, Bytes: bytesCopied}
 }
 
-func main() {
-  runtime.GOMAXPROCS(workers) // Set number of threads/workers
-  flag.Parse()
-
-  if err := os.MkdirAll(OutputPath, 0700); err != nil {
-    log.Fatal("Unable to create output path")
+// alreadySatisfiedBy reports whether a file already on disk matches the
+// size (and checksum, when the source supplied one) that was reported for
+// this download, meaning it can be skipped entirely.
+func (download Download) alreadySatisfiedBy(existingSize int64, destination string) bool {
+  if existingSize != download.File.Size {
+    return false
+  }
+  if !download.File.HasChecksum {
+    return true
   }
 
-  pendingDownloads := make(chan Download, workers)
-  results := make(chan DownloadResult, 1000)
-  done := make(chan struct{}, workers)
-
-  log.Println("Beginning fetch of Solr index...")
-  go queueIndexFileDownloads(pendingDownloads, SolrUrl, results)
-  for i := 0; i < workers; i++ {
-    go downloadIndexFiles(done, OutputPath, pendingDownloads)
+  checksum, err := adler32Of(destination)
+  if err != nil {
+    return false
   }
-  go awaitCompletion(done, results)
-  processResults(results)
+  return checksum == download.File.Checksum
 }
 
-func queueIndexFileDownloads(pendingDownloads chan<- Download, solrUrl string, results chan<- DownloadResult) (error) {
-  defer close(pendingDownloads)
-  // Step 1: Get information about the Solr Index
-  solrIndex, err := getLatestIndexInfo(solrUrl)
-    if err != nil {
-    log.Fatal("error: %+v", err)
+// fetchAndVerify downloads (or resumes) download.File from its Source into
+// destination, using an HTTP Range request via RangeSource to continue a
+// partial file left over from a previous attempt, then verifies the
+// result against the size/checksum the source reported. It returns the
+// number of bytes actually copied this call (not download.File.Size --
+// callers report that, not the file's total size, so stats reflect real
+// network activity on a resumed or retried download) and the HTTP status
+// code the source actually responded with.
+func (download Download) fetchAndVerify(ctx context.Context, destination string, bar *pb.ProgressBar, limiter *rate.Limiter) (int64, int, error) {
+  var resumeFrom int64
+  if partial, err := os.Stat(destination); err == nil {
+    resumeFrom = partial.Size()
   }
-  // Step 2: Get information about the files available
-  indexFiles, err := getIndexFileList(solrIndex)
-  if err != nil {
-    log.Fatal("error: %+v", err)
+
+  var body io.ReadCloser
+  var statusCode int
+  if resumeFrom > 0 && resumeFrom < download.File.Size {
+    if ranged, ok := download.Source.(RangeSource); ok {
+      r, status, err := ranged.OpenFileRange(ctx, download.Version, download.File, resumeFrom)
+      if err != nil {
+        return 0, status, err
+      }
+      body, statusCode = r, status
+    }
   }
-  // Step 3: Get the files
-  for _, file := range indexFiles {
-    url, err := generateFileDownloadUrl(solrIndex, file)
+  if body == nil {
+    r, status, err := download.Source.OpenFile(ctx, download.Version, download.File)
     if err != nil {
-      log.Fatal("Unable to create a url for: ", file)
+      return 0, status, err
     }
-
-    pendingDownloads <- Download{file.Name, url, results}
+    body, statusCode = r, status
   }
-
-  return nil
-}
-
-// Step 1: Get information about the index
-func getLatestIndexInfo(solrUrl string) (SolrIndex, error) {
-  solrIndex := SolrIndex{Url: solrUrl}
-  response, err := fetchIndexInfo(solrIndex.Url)
-  if err != nil {
-    log.Fatal(err)
+  defer body.Close()
+
+  // The source only honored our Range request if it responded 206; a 200
+  // means it sent the whole file back, so we must discard what was there
+  // and start the destination file over rather than appending to it.
+  resumed := statusCode == http.StatusPartialContent
+
+  flags := os.O_CREATE | os.O_WRONLY
+  if resumed {
+    flags |= os.O_APPEND
+  } else {
+    flags |= os.O_TRUNC
   }
 
-  indexDiscoveryResult, err := parseXmlIndexInfo(response)
+  out, err := os.OpenFile(destination, flags, 0644)
   if err != nil {
-    log.Fatal(err)
+    return 0, statusCode, err
   }
+  defer out.Close()
 
-  for _, metadata := range indexDiscoveryResult.Header.Metadata {
-    if metadata.Name == "status" && metadata.Value != "0" {
-      log.Fatal("Error, did not discover Solr Index info as expected: ", err)
-    }
+  var reader io.Reader = body
+  if limiter != nil {
+    reader = &rateLimitedReader{ctx: ctx, r: reader, limiter: limiter}
+  }
+  if bar != nil {
+    reader = io.TeeReader(reader, bar)
   }
 
-  for _, descriptor := range indexDiscoveryResult.VersionInfo {
-    switch descriptor.Name {
-    case "indexversion":
-      solrIndex.Version = descriptor.Value
-
-    case "generation":
-      solrIndex.Generation = descriptor.Value
-    }
+  bytesCopied, err := io.Copy(out, reader)
+  if err != nil {
+    return bytesCopied, statusCode, err
   }
 
-  return solrIndex, nil
+  if err := download.verify(destination); err != nil {
+    return bytesCopied, statusCode, err
+  }
+  return bytesCopied, statusCode, nil
 }
 
-func fetchIndexInfo(solrUrl string) (*http.Response, error) {
-  indexDiscoveryUrl, err := generateIndexDiscoveryUrl(solrUrl)
+// verify checks the downloaded file's size and, if the source reported
+// one, its adler32 checksum -- the same algorithm Solr's own replication
+// handler uses to validate index files.
+func (download Download) verify(destination string) error {
+  info, err := os.Stat(destination)
   if err != nil {
-    log.Fatal(err)
+    return err
+  }
+  if info.Size() != download.File.Size {
+    return fmt.Errorf("%s: size mismatch, got %d want %d", download.File.Name, info.Size(), download.File.Size)
+  }
+  if !download.File.HasChecksum {
+    return nil
   }
 
-  response, err := http.Get(indexDiscoveryUrl)
+  checksum, err := adler32Of(destination)
   if err != nil {
-    log.Fatal(err)
+    return err
   }
-
-  return response, nil
+  if checksum != download.File.Checksum {
+    return fmt.Errorf("%s: checksum mismatch, got %d want %d", download.File.Name, checksum, download.File.Checksum)
+  }
+  return nil
 }
 
-// http://172.20.20.20:8983/solr/replication?command=indexversion
-func generateIndexDiscoveryUrl(solrUrl string) (string, error) {
-  indexDiscoveryUrl, err := url.Parse(solrUrl)
+func adler32Of(path string) (uint32, error) {
+  file, err := os.Open(path)
   if err != nil {
-    log.Println("generateIndexDiscoveryUrl(): Unable to parse solrUrl.")
-    return "", err
+    return 0, err
   }
-  indexDiscoveryUrl.Path = path.Join(indexDiscoveryUrl.Path, "replication")
-
-  query := indexDiscoveryUrl.Query()
-  query.Set("command", "indexversion")
+  defer file.Close()
 
-  indexDiscoveryUrl.RawQuery = query.Encode()
-  return indexDiscoveryUrl.String(), err
+  hash := adler32.New()
+  if _, err := io.Copy(hash, file); err != nil {
+    return 0, err
+  }
+  return hash.Sum32(), nil
 }
 
-func parseXmlIndexInfo(response *http.Response) (*DiscoveryResult, error) {
-  xmlIndexInfo, err := ioutil.ReadAll(response.Body)
-  defer response.Body.Close()
-
+func init() {
+  defaultSuccessFile, err := filepath.Abs(filepath.Dir(os.Args[0]))
   if err != nil {
     log.Fatal(err)
   }
 
-  discoveryResult := DiscoveryResult{} 
-  err = xml.Unmarshal([]byte(xmlIndexInfo), &discoveryResult)
-  if err != nil {
-    log.Fatal("error: %+v", err)
-  }
+  const (
+    defaultSolrUrl = "http://172.20.20.20:8983/solr"
+    defaultOutputPath = "/var/lib/solr/data"
+  )
 
-  return &discoveryResult, nil
+  flag.StringVar(&SolrUrl, "l", defaultSolrUrl, "Location of the replication source (Solr base URL, or manifest URL when -source=manifest)")
+  flag.StringVar(&OutputPath, "o", defaultOutputPath, "Output location of the downloaded solr index")
+  flag.StringVar(&SuccessFile, "s", defaultSuccessFile, "Path to the file which indicates that all the files downloaded successfully")
+  flag.StringVar(&SourceName, "source", "solr", "Replication source to pull from: solr or manifest")
+  flag.BoolVar(&NoProgress, "no-progress", false, "Disable the interactive progress bar")
+  flag.BoolVar(&Silent, "silent", false, "Suppress all non-essential output, including the progress bar")
+  flag.DurationVar(&Timeout, "timeout", 0, "Per-HTTP-request timeout (ie: 30s, 2m). Zero disables the timeout.")
+  flag.IntVar(&Concurrency, "concurrency", runtime.NumCPU()/2, "Number of files to download concurrently")
+  flag.Float64Var(&MaxBandwidthMBps, "max-bandwidth", 0, "Cap aggregate download throughput in MB/s per worker. Zero disables the limit.")
+  flag.DurationVar(&FetchDelay, "fetch-delay", 0, "Delay between starting each file download, to throttle a busy master")
 }
 
-// Step 2: Get the index file info and return meaningful data structures
-func getIndexFileList(solrIndex SolrIndex) ([]IndexFile, error) {
-  indexFiles := make([]IndexFile, 0)
-  response, err := fetchIndexFileData(solrIndex)
-  if err != nil {
-    log.Fatal(err)
+func main() {
+  flag.Parse()
+
+  workers = Concurrency
+  if workers < 1 {
+    workers = 1
   }
+  runtime.GOMAXPROCS(workers) // Set number of threads/workers
 
-  fileListResult, err := parseXmlFileList(response)
-  if err != nil {
-    log.Fatal(err)
+  if Silent {
+    NoProgress = true
   }
 
-  for _, metadata := range fileListResult.Header.Metadata {
-    if metadata.Name == "status" && metadata.Value != "0" {
-      log.Fatal("Error, did not discover Solr files as expected: ", err)
-    }
+  if err := os.MkdirAll(OutputPath, 0700); err != nil {
+    log.Fatal("Unable to create output path")
   }
 
-  for _, filelist := range fileListResult.Filesets {
-    if filelist.Name == "filelist" {
-      indexFiles = filelist.Files
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+
+  signals := make(chan os.Signal, 1)
+  signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+  go func() {
+    sig := <-signals
+    if !Silent {
+      log.Printf("received %s, cancelling in-flight downloads...", sig)
     }
+    cancel()
+  }()
+
+  httpClient := &http.Client{
+    Timeout: Timeout,
+    Transport: &http.Transport{
+      MaxIdleConns: workers * 2,
+      MaxIdleConnsPerHost: workers * 2,
+      IdleConnTimeout: 90 * time.Second,
+    },
   }
 
-  return indexFiles, nil
-}
+  var limiter *rate.Limiter
+  if MaxBandwidthMBps > 0 {
+    const minBurst = 64 * 1024 // larger than io.Copy's 32KB default buffer
+    bytesPerSec := MaxBandwidthMBps * 1024 * 1024
+    burst := int(bytesPerSec)
+    if burst < minBurst {
+      burst = minBurst
+    }
+    limiter = rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+  }
 
-// http://172.20.20.20:8983/solr/replication?command=filelist&indexversion=1401508582278&generation=13
-func generateFileDiscoveryUrl(solrIndex SolrIndex) (string, error) {
-  fileDiscoveryUrl, err := url.Parse(solrIndex.Url)
+  source, err := newSource(SourceName, SolrUrl, httpClient)
   if err != nil {
-    log.Fatal("generateFileDiscoveryUrl(): Unable to parse solrUrl.")
-    return "", err
+    log.Fatal(err)
   }
 
-  fileDiscoveryUrl.Path = path.Join(fileDiscoveryUrl.Path, "replication")
+  if !Silent {
+    log.Println("Beginning fetch of index...")
+  }
 
-  query := fileDiscoveryUrl.Query()
-  query.Set("command", "filelist")
-  query.Set("indexversion", solrIndex.Version)
-  query.Set("generation", solrIndex.Generation)
+  version, err := source.LatestVersion(ctx)
+  if err != nil {
+    log.Fatal(err)
+  }
+  remoteFiles, err := source.ListFiles(ctx, version)
+  if err != nil {
+    log.Fatal(err)
+  }
 
-  fileDiscoveryUrl.RawQuery = query.Encode()
+  var totalBytes int64
+  for _, file := range remoteFiles {
+    totalBytes += file.Size
+  }
 
-  return fileDiscoveryUrl.String(), nil
-}
+  var bar *pb.ProgressBar
+  if !NoProgress {
+    bar = pb.New64(totalBytes).SetUnits(pb.U_BYTES)
+    bar.ShowSpeed = true
+    bar.Start()
+  }
 
-func parseXmlFileList(response *http.Response) (FileListResult, error) {
-  xmlFileList, err := ioutil.ReadAll(response.Body)
-  defer response.Body.Close()
+  pendingDownloads := make(chan Download, workers)
+  results := make(chan DownloadResult, 1000)
+  done := make(chan struct{}, workers)
 
-  if err != nil {
-    log.Fatal(err)
+  go queueDownloads(ctx, pendingDownloads, source, version, remoteFiles)
+  for i := 0; i < workers; i++ {
+    go downloadIndexFiles(ctx, done, OutputPath, pendingDownloads, bar, limiter, results)
   }
+  go awaitCompletion(done, results)
 
-  fileListResult := FileListResult{} 
-  err = xml.Unmarshal([]byte(xmlFileList), &fileListResult)
-  if err != nil {
-    log.Fatal("error: %+v", err)
+  start := time.Now()
+  stats, failedNames := processResults(results)
+  stats.ElapsedSeconds = time.Since(start).Seconds()
+  if stats.ElapsedSeconds > 0 {
+    stats.ThroughputBytesPerSec = float64(stats.Bytes) / stats.ElapsedSeconds
   }
 
-  return fileListResult, nil
-}
-
-// Step 3: Download
-// http://172.20.20.20:8983/solr/replication?command=filecontent&wt=filestream&indexversion=1401508582278&generation=13&file=segments_d
-func fetchIndexFileData(solrIndex SolrIndex) (*http.Response, error) {
-  fileDiscoveryUrl, err := generateFileDiscoveryUrl(solrIndex)
-  if err != nil {
-    log.Fatal(err)
+  if bar != nil {
+    bar.Finish()
   }
 
-  response, err := http.Get(fileDiscoveryUrl)
-  if err != nil {
-    log.Fatal(err)
+  if len(failedNames) > 0 || ctx.Err() != nil {
+    cleanupPartialFiles(OutputPath, failedNames)
+    if !Silent {
+      log.Println("download did not complete successfully; not writing success file")
+    }
+    os.Exit(1)
   }
 
-  return response, nil
+  writeSuccessFile(version, remoteFiles)
+
+  // Silent only suppresses the chatty log/progress-bar output -- the JSON
+  // stats blob is the one output --silent scripts are meant to consume.
+  emitStats(stats)
+}
+
+func newSource(name string, location string, client *http.Client) (Source, error) {
+  switch name {
+  case "solr":
+    return &SolrReplicationSource{Url: location, Client: client}, nil
+  case "manifest":
+    return &ManifestSource{ManifestUrl: location, Client: client}, nil
+  default:
+    return nil, fmt.Errorf("unknown -source %q: must be solr or manifest", name)
+  }
 }
 
-func generateFileDownloadUrl(solrIndex SolrIndex, file IndexFile) (string, error) {
-  downloadUrl, err := url.Parse(solrIndex.Url)
+func emitStats(stats Stats) {
+  data, err := json.Marshal(stats)
   if err != nil {
     log.Fatal(err)
   }
-  downloadUrl.Path = path.Join(downloadUrl.Path, "replication")
-
-  query := downloadUrl.Query()
-  query.Set("command", "filecontent")
-  query.Set("wt", "filestream")
-  query.Set("indexversion", solrIndex.Version)
-  query.Set("generation", solrIndex.Generation)
-  query.Set("file", file.Name)
+  os.Stdout.Write(data)
+  os.Stdout.Write([]byte("\n"))
+}
 
-  downloadUrl.RawQuery = query.Encode()
+func queueDownloads(ctx context.Context, pendingDownloads chan<- Download, source Source, version Version, files []RemoteFile) {
+  defer close(pendingDownloads)
+  for i, file := range files {
+    select {
+    case pendingDownloads <- Download{source, version, file}:
+    case <-ctx.Done():
+      return
+    }
 
-  return downloadUrl.String(), nil
+    if FetchDelay > 0 && i < len(files)-1 {
+      select {
+      case <-time.After(FetchDelay):
+      case <-ctx.Done():
+        return
+      }
+    }
+  }
 }
 
 // Channel stuffs
-func downloadIndexFiles(done chan<- struct{}, outputPath string, pendingDownloads <-chan Download) {
+func downloadIndexFiles(ctx context.Context, done chan<- struct{}, outputPath string, pendingDownloads <-chan Download, bar *pb.ProgressBar, limiter *rate.Limiter, results chan<- DownloadResult) {
   for download := range pendingDownloads {
-    download.Do(outputPath)
+    results <- download.Do(ctx, outputPath, bar, limiter)
   }
   done <- struct{}{}
 }
@@ -353,8 +462,62 @@ func awaitCompletion(done <-chan struct{}, results chan DownloadResult) {
   }
 }
 
-func processResults(results <-chan DownloadResult) {
+func processResults(results <-chan DownloadResult) (Stats, []string) {
+  stats := Stats{}
+  var failedNames []string
+
   for result := range results {
+    if result.Err != nil {
+      if !Silent {
+        log.Printf("%s: %v", result.Name, result.Err)
+      }
+      failedNames = append(failedNames, result.Name)
+      continue
+    }
+
+    if !Silent {
       log.Printf("%+v\n", result)
+    }
+    stats.Files++
+    stats.Bytes += result.Bytes
+    stats.PerFile = append(stats.PerFile, FileStat{result.Name, result.StatusCode, result.Skipped, result.Bytes})
   }
-}
\ No newline at end of file
+  return stats, failedNames
+}
+
+// cleanupPartialFiles removes the on-disk files for downloads that never
+// completed successfully, so a cancelled or failed run doesn't leave
+// corrupt files behind for the next run (or Solr itself) to trip over.
+func cleanupPartialFiles(outputPath string, names []string) {
+  for _, name := range names {
+    if err := os.Remove(path.Join(outputPath, name)); err != nil && !os.IsNotExist(err) {
+      log.Printf("unable to remove partial file %s: %v", name, err)
+    }
+  }
+}
+
+// writeSuccessFile records per-file version/generation/checksum metadata so
+// a subsequent run can recognize already-complete files and behave like a
+// true incremental replica instead of re-downloading everything.
+func writeSuccessFile(version Version, files []RemoteFile) {
+  records := make([]FileRecord, len(files))
+  for i, file := range files {
+    records[i] = FileRecord{
+      Name: file.Name,
+      Version: version.Index,
+      Generation: version.Generation,
+      Size: file.Size,
+      Checksum: file.Checksum,
+      HasChecksum: file.HasChecksum,
+    }
+  }
+
+  data, err := json.MarshalIndent(records, "", "  ")
+  if err != nil {
+    log.Fatal(err)
+  }
+
+  if err := ioutil.WriteFile(SuccessFile, data, 0644); err != nil {
+    log.Fatal(err)
+  }
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestDownloadAlreadySatisfiedBy(t *testing.T) {
+  dir := t.TempDir()
+  destination := filepath.Join(dir, "segments_1")
+  if err := os.WriteFile(destination, []byte("hello"), 0644); err != nil {
+    t.Fatalf("WriteFile: %v", err)
+  }
+  // adler32("hello") = 0x062c0215
+  const helloChecksum = 0x062c0215
+
+  cases := []struct {
+    name string
+    file RemoteFile
+    want bool
+  }{
+    {
+      name: "size mismatch",
+      file: RemoteFile{Size: 999},
+      want: false,
+    },
+    {
+      name: "size matches, no checksum reported",
+      file: RemoteFile{Size: 5},
+      want: true,
+    },
+    {
+      name: "size and checksum match",
+      file: RemoteFile{Size: 5, Checksum: helloChecksum, HasChecksum: true},
+      want: true,
+    },
+    {
+      name: "size matches but checksum does not",
+      file: RemoteFile{Size: 5, Checksum: 123, HasChecksum: true},
+      want: false,
+    },
+  }
+
+  for _, c := range cases {
+    t.Run(c.name, func(t *testing.T) {
+      download := Download{File: c.file}
+      got := download.alreadySatisfiedBy(5, destination)
+      if got != c.want {
+        t.Errorf("alreadySatisfiedBy() = %v, want %v", got, c.want)
+      }
+    })
+  }
+}
+
+func TestDownloadVerify(t *testing.T) {
+  dir := t.TempDir()
+  destination := filepath.Join(dir, "segments_1")
+  if err := os.WriteFile(destination, []byte("hello"), 0644); err != nil {
+    t.Fatalf("WriteFile: %v", err)
+  }
+  const helloChecksum = 0x062c0215
+
+  cases := []struct {
+    name string
+    file RemoteFile
+    wantErr bool
+  }{
+    {
+      name: "size mismatch",
+      file: RemoteFile{Size: 999},
+      wantErr: true,
+    },
+    {
+      name: "size matches, no checksum to check",
+      file: RemoteFile{Size: 5},
+      wantErr: false,
+    },
+    {
+      name: "size and checksum match",
+      file: RemoteFile{Size: 5, Checksum: helloChecksum, HasChecksum: true},
+      wantErr: false,
+    },
+    {
+      name: "checksum mismatch",
+      file: RemoteFile{Size: 5, Checksum: 123, HasChecksum: true},
+      wantErr: true,
+    },
+  }
+
+  for _, c := range cases {
+    t.Run(c.name, func(t *testing.T) {
+      download := Download{File: c.file}
+      err := download.verify(destination)
+      if (err != nil) != c.wantErr {
+        t.Errorf("verify() error = %v, wantErr %v", err, c.wantErr)
+      }
+    })
+  }
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+  "context"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "path"
+  "strconv"
+)
+
+/* Solr XML Response header types */
+type ResponseHeader struct {
+  Metadata []HeaderData `xml:"int"`
+}
+
+type HeaderData struct {
+  Name string `xml:"name,attr"`
+  Value string `xml:",innerxml"`
+}
+
+/* Solr XML Index Discovery types */
+type DiscoveryResult struct {
+  Header ResponseHeader `xml:"lst"`
+  VersionInfo []VersionInfo `xml:"long"`
+}
+
+type VersionInfo struct {
+  Name string `xml:"name,attr"`
+  Value string `xml:",innerxml"`
+}
+
+/* Solr XML File Discovery types */
+type FileListResult struct {
+  Header ResponseHeader `xml:"lst"`
+  Filesets []FileList `xml:"arr"`
+}
+
+type FileList struct {
+  Name  string      `xml:"name,attr"`
+  Files []IndexFile `xml:"lst"`
+}
+
+// A single file entry from Solr's filelist response. Solr emits one <str
+// name="name">, one <long name="size">, and (when checksums are enabled on
+// the master) one <long name="checksum">, so we parse generically by name
+// attribute rather than relying on tag order/position.
+type IndexFile struct {
+  Fields []FileField `xml:",any"`
+
+  Name string `xml:"-"`
+  Size int64 `xml:"-"`
+  Checksum uint32 `xml:"-"`
+  HasChecksum bool `xml:"-"`
+}
+
+type FileField struct {
+  XMLName xml.Name
+  Value string `xml:",innerxml"`
+}
+
+func (file *IndexFile) resolveFields() error {
+  var sawSize bool
+  for _, field := range file.Fields {
+    switch field.XMLName.Local {
+    case "str":
+      file.Name = field.Value
+    case "long":
+      // The first long we see is size; a second one (if present) is the
+      // checksum. Solr never sends more than these two. A zero-byte file
+      // (lock/generation files are sometimes empty) legitimately has
+      // Size == 0, so we track which long we're on rather than branching
+      // on the parsed value.
+      if !sawSize {
+        size, err := strconv.ParseInt(field.Value, 10, 64)
+        if err != nil {
+          return err
+        }
+        file.Size = size
+        sawSize = true
+      } else {
+        checksum, err := strconv.ParseUint(field.Value, 10, 32)
+        if err != nil {
+          return err
+        }
+        file.Checksum = uint32(checksum)
+        file.HasChecksum = true
+      }
+    }
+  }
+  return nil
+}
+
+type SolrIndex struct {
+  Url string
+  Version string
+  Generation string
+}
+
+// SolrReplicationSource is a Source backed by Solr's built-in replication
+// handler (the same endpoints the stock Java replica poller uses).
+type SolrReplicationSource struct {
+  Url string
+  Client *http.Client
+}
+
+func (source *SolrReplicationSource) client() *http.Client {
+  if source.Client != nil {
+    return source.Client
+  }
+  return http.DefaultClient
+}
+
+func (source *SolrReplicationSource) LatestVersion(ctx context.Context) (Version, error) {
+  solrIndex, err := getLatestIndexInfo(ctx, source.client(), source.Url)
+  if err != nil {
+    return Version{}, err
+  }
+  return Version{Index: solrIndex.Version, Generation: solrIndex.Generation}, nil
+}
+
+func (source *SolrReplicationSource) ListFiles(ctx context.Context, version Version) ([]RemoteFile, error) {
+  indexFiles, err := getIndexFileList(ctx, source.client(), source.solrIndex(version))
+  if err != nil {
+    return nil, err
+  }
+
+  files := make([]RemoteFile, len(indexFiles))
+  for i, file := range indexFiles {
+    files[i] = RemoteFile{Name: file.Name, Size: file.Size, Checksum: file.Checksum, HasChecksum: file.HasChecksum}
+  }
+  return files, nil
+}
+
+func (source *SolrReplicationSource) OpenFile(ctx context.Context, version Version, file RemoteFile) (io.ReadCloser, int, error) {
+  downloadUrl, err := generateFileDownloadUrl(source.solrIndex(version), IndexFile{Name: file.Name})
+  if err != nil {
+    return nil, 0, err
+  }
+
+  request, err := http.NewRequestWithContext(ctx, "GET", downloadUrl, nil)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  response, err := source.client().Do(request)
+  if err != nil {
+    return nil, 0, err
+  }
+  if response.StatusCode < 200 || response.StatusCode >= 300 {
+    defer response.Body.Close()
+    return nil, response.StatusCode, fmt.Errorf("fetching %s: unexpected status %s", downloadUrl, response.Status)
+  }
+  return response.Body, response.StatusCode, nil
+}
+
+func (source *SolrReplicationSource) OpenFileRange(ctx context.Context, version Version, file RemoteFile, offset int64) (io.ReadCloser, int, error) {
+  downloadUrl, err := generateFileDownloadUrl(source.solrIndex(version), IndexFile{Name: file.Name})
+  if err != nil {
+    return nil, 0, err
+  }
+  return rangeGet(ctx, source.client(), downloadUrl, offset)
+}
+
+func (source *SolrReplicationSource) solrIndex(version Version) SolrIndex {
+  return SolrIndex{Url: source.Url, Version: version.Index, Generation: version.Generation}
+}
+
+// Step 1: Get information about the index
+func getLatestIndexInfo(ctx context.Context, client *http.Client, solrUrl string) (SolrIndex, error) {
+  solrIndex := SolrIndex{Url: solrUrl}
+  response, err := fetchIndexInfo(ctx, client, solrIndex.Url)
+  if err != nil {
+    return solrIndex, err
+  }
+
+  indexDiscoveryResult, err := parseXmlIndexInfo(response)
+  if err != nil {
+    return solrIndex, err
+  }
+
+  for _, metadata := range indexDiscoveryResult.Header.Metadata {
+    if metadata.Name == "status" && metadata.Value != "0" {
+      return solrIndex, fmt.Errorf("did not discover Solr Index info as expected")
+    }
+  }
+
+  for _, descriptor := range indexDiscoveryResult.VersionInfo {
+    switch descriptor.Name {
+    case "indexversion":
+      solrIndex.Version = descriptor.Value
+
+    case "generation":
+      solrIndex.Generation = descriptor.Value
+    }
+  }
+
+  return solrIndex, nil
+}
+
+func fetchIndexInfo(ctx context.Context, client *http.Client, solrUrl string) (*http.Response, error) {
+  indexDiscoveryUrl, err := generateIndexDiscoveryUrl(solrUrl)
+  if err != nil {
+    return nil, err
+  }
+
+  request, err := http.NewRequestWithContext(ctx, "GET", indexDiscoveryUrl, nil)
+  if err != nil {
+    return nil, err
+  }
+
+  return client.Do(request)
+}
+
+// http://172.20.20.20:8983/solr/replication?command=indexversion
+func generateIndexDiscoveryUrl(solrUrl string) (string, error) {
+  indexDiscoveryUrl, err := url.Parse(solrUrl)
+  if err != nil {
+    return "", err
+  }
+  indexDiscoveryUrl.Path = path.Join(indexDiscoveryUrl.Path, "replication")
+
+  query := indexDiscoveryUrl.Query()
+  query.Set("command", "indexversion")
+
+  indexDiscoveryUrl.RawQuery = query.Encode()
+  return indexDiscoveryUrl.String(), nil
+}
+
+func parseXmlIndexInfo(response *http.Response) (*DiscoveryResult, error) {
+  defer response.Body.Close()
+  xmlIndexInfo, err := ioutil.ReadAll(response.Body)
+  if err != nil {
+    return nil, err
+  }
+
+  discoveryResult := DiscoveryResult{}
+  if err = xml.Unmarshal(xmlIndexInfo, &discoveryResult); err != nil {
+    return nil, err
+  }
+
+  return &discoveryResult, nil
+}
+
+// Step 2: Get the index file info and return meaningful data structures
+func getIndexFileList(ctx context.Context, client *http.Client, solrIndex SolrIndex) ([]IndexFile, error) {
+  indexFiles := make([]IndexFile, 0)
+  response, err := fetchIndexFileData(ctx, client, solrIndex)
+  if err != nil {
+    return nil, err
+  }
+
+  fileListResult, err := parseXmlFileList(response)
+  if err != nil {
+    return nil, err
+  }
+
+  for _, metadata := range fileListResult.Header.Metadata {
+    if metadata.Name == "status" && metadata.Value != "0" {
+      return nil, fmt.Errorf("did not discover Solr files as expected")
+    }
+  }
+
+  for _, filelist := range fileListResult.Filesets {
+    if filelist.Name == "filelist" {
+      indexFiles = filelist.Files
+    }
+  }
+
+  for i := range indexFiles {
+    if err := indexFiles[i].resolveFields(); err != nil {
+      return nil, err
+    }
+  }
+
+  return indexFiles, nil
+}
+
+// http://172.20.20.20:8983/solr/replication?command=filelist&indexversion=1401508582278&generation=13
+func generateFileDiscoveryUrl(solrIndex SolrIndex) (string, error) {
+  fileDiscoveryUrl, err := url.Parse(solrIndex.Url)
+  if err != nil {
+    return "", err
+  }
+
+  fileDiscoveryUrl.Path = path.Join(fileDiscoveryUrl.Path, "replication")
+
+  query := fileDiscoveryUrl.Query()
+  query.Set("command", "filelist")
+  query.Set("indexversion", solrIndex.Version)
+  query.Set("generation", solrIndex.Generation)
+
+  fileDiscoveryUrl.RawQuery = query.Encode()
+
+  return fileDiscoveryUrl.String(), nil
+}
+
+func parseXmlFileList(response *http.Response) (FileListResult, error) {
+  defer response.Body.Close()
+  xmlFileList, err := ioutil.ReadAll(response.Body)
+  if err != nil {
+    return FileListResult{}, err
+  }
+
+  fileListResult := FileListResult{}
+  if err = xml.Unmarshal(xmlFileList, &fileListResult); err != nil {
+    return FileListResult{}, err
+  }
+
+  return fileListResult, nil
+}
+
+// Step 3: Download
+// http://172.20.20.20:8983/solr/replication?command=filecontent&wt=filestream&indexversion=1401508582278&generation=13&file=segments_d
+func fetchIndexFileData(ctx context.Context, client *http.Client, solrIndex SolrIndex) (*http.Response, error) {
+  fileDiscoveryUrl, err := generateFileDiscoveryUrl(solrIndex)
+  if err != nil {
+    return nil, err
+  }
+
+  request, err := http.NewRequestWithContext(ctx, "GET", fileDiscoveryUrl, nil)
+  if err != nil {
+    return nil, err
+  }
+
+  return client.Do(request)
+}
+
+func generateFileDownloadUrl(solrIndex SolrIndex, file IndexFile) (string, error) {
+  downloadUrl, err := url.Parse(solrIndex.Url)
+  if err != nil {
+    return "", err
+  }
+  downloadUrl.Path = path.Join(downloadUrl.Path, "replication")
+
+  query := downloadUrl.Query()
+  query.Set("command", "filecontent")
+  query.Set("wt", "filestream")
+  query.Set("indexversion", solrIndex.Version)
+  query.Set("generation", solrIndex.Generation)
+  query.Set("file", file.Name)
+
+  downloadUrl.RawQuery = query.Encode()
+
+  return downloadUrl.String(), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+  "encoding/xml"
+  "testing"
+)
+
+func TestIndexFileResolveFields(t *testing.T) {
+  cases := []struct {
+    name string
+    xml string
+    wantName string
+    wantSize int64
+    wantChecksum uint32
+    wantHasChecksum bool
+  }{
+    {
+      name: "size only",
+      xml: `<lst><str name="name">segments_1</str><long name="size">1024</long></lst>`,
+      wantName: "segments_1",
+      wantSize: 1024,
+    },
+    {
+      name: "size and checksum",
+      xml: `<lst><str name="name">_0.fdt</str><long name="size">2048</long><long name="checksum">555</long></lst>`,
+      wantName: "_0.fdt",
+      wantSize: 2048,
+      wantChecksum: 555,
+      wantHasChecksum: true,
+    },
+    {
+      // Regression test: a zero-byte file (lock/generation files can be
+      // empty) used to be mistaken for "haven't seen size yet", which
+      // caused the checksum to overwrite Size and HasChecksum to never
+      // be set.
+      name: "zero size with checksum",
+      xml: `<lst><str name="name">write.lock</str><long name="size">0</long><long name="checksum">777</long></lst>`,
+      wantName: "write.lock",
+      wantSize: 0,
+      wantChecksum: 777,
+      wantHasChecksum: true,
+    },
+    {
+      name: "zero size without checksum",
+      xml: `<lst><str name="name">write.lock</str><long name="size">0</long></lst>`,
+      wantName: "write.lock",
+      wantSize: 0,
+      wantHasChecksum: false,
+    },
+  }
+
+  for _, c := range cases {
+    t.Run(c.name, func(t *testing.T) {
+      var file IndexFile
+      if err := xml.Unmarshal([]byte(c.xml), &file); err != nil {
+        t.Fatalf("xml.Unmarshal: %v", err)
+      }
+      if err := file.resolveFields(); err != nil {
+        t.Fatalf("resolveFields: %v", err)
+      }
+
+      if file.Name != c.wantName {
+        t.Errorf("Name = %q, want %q", file.Name, c.wantName)
+      }
+      if file.Size != c.wantSize {
+        t.Errorf("Size = %d, want %d", file.Size, c.wantSize)
+      }
+      if file.Checksum != c.wantChecksum {
+        t.Errorf("Checksum = %d, want %d", file.Checksum, c.wantChecksum)
+      }
+      if file.HasChecksum != c.wantHasChecksum {
+        t.Errorf("HasChecksum = %v, want %v", file.HasChecksum, c.wantHasChecksum)
+      }
+    })
+  }
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net/http"
+)
+
+// Version identifies a specific, immutable snapshot of a replication
+// source's file set. For SolrReplicationSource this is the indexversion
+// and generation pair Solr reports; other sources may use it differently
+// (ManifestSource just carries the manifest's own URL).
+type Version struct {
+  Index string
+  Generation string
+}
+
+// RemoteFile describes one file available from a Source: its name, the
+// size and (optionally) checksum the source reported for it, and -- for
+// sources that address files directly by URL rather than by regenerating
+// one from a version -- the URL to fetch it from.
+type RemoteFile struct {
+  Name string
+  Size int64
+  Checksum uint32
+  HasChecksum bool
+  Url string
+}
+
+// Source is anything the worker/queue machinery can pull a file set from:
+// the Solr replication handler, a static manifest, or any future backend.
+// Discovering the latest version and listing its files are separate from
+// opening any one file so that the queueing loop can report a total byte
+// count (for the progress bar) before downloads begin. Every method takes
+// a context so a cancelled replication run aborts in-flight requests
+// instead of leaving the process to finish them.
+type Source interface {
+  LatestVersion(ctx context.Context) (Version, error)
+  ListFiles(ctx context.Context, version Version) ([]RemoteFile, error)
+
+  // OpenFile opens file and reports the HTTP status code the source
+  // actually responded with, so callers can surface it (e.g. in per-file
+  // stats) instead of assuming success whenever no error is returned.
+  OpenFile(ctx context.Context, version Version, file RemoteFile) (io.ReadCloser, int, error)
+}
+
+// RangeSource is implemented by sources that can resume a partial
+// download via an HTTP byte range. Download.fetchAndVerify type-asserts
+// for this rather than requiring it of every Source, since not every
+// backend (e.g. a manifest pointing at arbitrary URLs) is guaranteed to
+// support it.
+type RangeSource interface {
+  Source
+
+  // OpenFileRange opens file starting at byte offset. The returned status
+  // code tells the caller whether the range was honored (206) or the
+  // source just sent the whole file back (200, in which case the caller
+  // must discard what it already has and re-download from the start).
+  OpenFileRange(ctx context.Context, version Version, file RemoteFile, offset int64) (io.ReadCloser, int, error)
+}
+
+// ManifestSource replicates an arbitrary, static set of files described by
+// a JSON manifest at ManifestUrl -- a flat array of {name, size, checksum,
+// url} objects. This is useful for mirroring file sets that don't come
+// from a Solr master at all, such as a WARC collection, behind the same
+// worker/queue machinery.
+type ManifestSource struct {
+  ManifestUrl string
+  Client *http.Client
+}
+
+type manifestEntry struct {
+  Name string `json:"name"`
+  Size int64 `json:"size"`
+  Checksum uint32 `json:"checksum"`
+  Url string `json:"url"`
+}
+
+func (source *ManifestSource) client() *http.Client {
+  if source.Client != nil {
+    return source.Client
+  }
+  return http.DefaultClient
+}
+
+// LatestVersion has no real meaning for a static manifest, so it just
+// reports the manifest's own URL as the version identity.
+func (source *ManifestSource) LatestVersion(ctx context.Context) (Version, error) {
+  return Version{Index: source.ManifestUrl}, nil
+}
+
+func (source *ManifestSource) ListFiles(ctx context.Context, version Version) ([]RemoteFile, error) {
+  request, err := http.NewRequestWithContext(ctx, "GET", source.ManifestUrl, nil)
+  if err != nil {
+    return nil, err
+  }
+
+  response, err := source.client().Do(request)
+  if err != nil {
+    return nil, err
+  }
+  defer response.Body.Close()
+
+  var entries []manifestEntry
+  if err := json.NewDecoder(response.Body).Decode(&entries); err != nil {
+    return nil, err
+  }
+
+  files := make([]RemoteFile, len(entries))
+  for i, entry := range entries {
+    files[i] = RemoteFile{
+      Name: entry.Name,
+      Size: entry.Size,
+      Checksum: entry.Checksum,
+      HasChecksum: entry.Checksum != 0,
+      Url: entry.Url,
+    }
+  }
+  return files, nil
+}
+
+func (source *ManifestSource) OpenFile(ctx context.Context, version Version, file RemoteFile) (io.ReadCloser, int, error) {
+  request, err := http.NewRequestWithContext(ctx, "GET", file.Url, nil)
+  if err != nil {
+    return nil, 0, err
+  }
+
+  response, err := source.client().Do(request)
+  if err != nil {
+    return nil, 0, err
+  }
+  if response.StatusCode < 200 || response.StatusCode >= 300 {
+    defer response.Body.Close()
+    return nil, response.StatusCode, fmt.Errorf("fetching %s: unexpected status %s", file.Url, response.Status)
+  }
+  return response.Body, response.StatusCode, nil
+}
+
+func (source *ManifestSource) OpenFileRange(ctx context.Context, version Version, file RemoteFile, offset int64) (io.ReadCloser, int, error) {
+  return rangeGet(ctx, source.client(), file.Url, offset)
+}
+
+// rangeGet issues a GET request for url with a "Range: bytes=offset-"
+// header and returns the status code the server actually responded with
+// -- 206 Partial Content if it honored the range, 200 if it just sent the
+// whole thing back (in which case the caller should discard offset and
+// start over). Any other status is treated as an error.
+func rangeGet(ctx context.Context, client *http.Client, url string, offset int64) (io.ReadCloser, int, error) {
+  request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+  if err != nil {
+    return nil, 0, err
+  }
+  request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+  response, err := client.Do(request)
+  if err != nil {
+    return nil, 0, err
+  }
+  if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+    defer response.Body.Close()
+    return nil, response.StatusCode, fmt.Errorf("range request for %s: unexpected status %s", url, response.Status)
+  }
+  return response.Body, response.StatusCode, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+  "context"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+func TestManifestSourceListFiles(t *testing.T) {
+  const manifestBody = `[
+    {"name": "segments_1", "size": 1024, "checksum": 555, "url": "http://example.com/segments_1"},
+    {"name": "write.lock", "size": 0, "url": "http://example.com/write.lock"}
+  ]`
+
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(manifestBody))
+  }))
+  defer server.Close()
+
+  source := &ManifestSource{ManifestUrl: server.URL}
+  files, err := source.ListFiles(context.Background(), Version{})
+  if err != nil {
+    t.Fatalf("ListFiles: %v", err)
+  }
+
+  want := []RemoteFile{
+    {Name: "segments_1", Size: 1024, Checksum: 555, HasChecksum: true, Url: "http://example.com/segments_1"},
+    {Name: "write.lock", Size: 0, Checksum: 0, HasChecksum: false, Url: "http://example.com/write.lock"},
+  }
+
+  if len(files) != len(want) {
+    t.Fatalf("got %d files, want %d", len(files), len(want))
+  }
+  for i, got := range files {
+    if got != want[i] {
+      t.Errorf("file %d = %+v, want %+v", i, got, want[i])
+    }
+  }
+}
+
+func TestManifestSourceListFilesBadJson(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte("not json"))
+  }))
+  defer server.Close()
+
+  source := &ManifestSource{ManifestUrl: server.URL}
+  if _, err := source.ListFiles(context.Background(), Version{}); err == nil {
+    t.Fatal("expected an error for malformed manifest JSON, got nil")
+  }
+}